@@ -0,0 +1,46 @@
+package quic
+
+import (
+	"net"
+	"net/netip"
+	"time"
+)
+
+// packetInfo contains the out-of-band information carried alongside a
+// received datagram: the local address the datagram was sent to, and the
+// index of the interface it arrived on. Both are populated from IP_PKTINFO /
+// IPV6_PKTINFO control messages where the platform supports them.
+type packetInfo struct {
+	addr    netip.Addr
+	ifIndex uint32
+}
+
+// ECN is the ECN marking of a packet, as carried in the two low bits of the
+// IPv4 TOS / IPv6 Traffic Class byte. See RFC 3168.
+type ECN uint8
+
+const (
+	// ECNNon is the Not-ECT codepoint: the sender doesn't support ECN.
+	ECNNon ECN = iota
+	// ECNECT1 is the ECT(1) codepoint.
+	ECNECT1
+	// ECNECT0 is the ECT(0) codepoint.
+	ECNECT0
+	// ECNCE is the Congestion Experienced codepoint, set by a congested
+	// router on a packet that was marked ECT(0) or ECT(1).
+	ECNCE
+)
+
+// receivedPacket is a single UDP datagram read off the wire, along with the
+// out-of-band information the kernel attached to it.
+type receivedPacket struct {
+	remoteAddr net.Addr
+	rcvTime    time.Time
+	data       []byte
+	info       packetInfo
+	// ecn is the packet's ECN marking, parsed from an IP_RECVTOS /
+	// IPV6_RECVTCLASS control message where the platform supports it. Only
+	// the receive path sets it; no congestion controller in this package
+	// reads it.
+	ecn ECN
+}
@@ -0,0 +1,229 @@
+//go:build linux
+
+package quic
+
+import (
+	"errors"
+	"net"
+	"syscall"
+	"time"
+
+	"golang.org/x/net/ipv4"
+	"golang.org/x/sys/unix"
+)
+
+// defaultBatchSize is used when Transport.ReceiveBatchSize is left at its
+// zero value.
+const defaultBatchSize = 8
+
+// maxPacketBufferSize is large enough to hold a maximum-size UDP datagram,
+// including one that's been coalesced by GRO.
+const maxPacketBufferSize = 1 << 16
+
+// maxGROSegments bounds the number of UDP_GRO segments a single coalesced
+// message is split into. The kernel already caps this well below this
+// value; it's a defensive limit, not a behavioral one.
+const maxGROSegments = 64
+
+// oobBufferSize is sized to hold an IP_PKTINFO (or IPV6_PKTINFO) cmsg, a
+// UDP_GRO cmsg, and an IP_TOS/IPV6_TCLASS cmsg.
+const oobBufferSize = 128
+
+// batchConn wraps a raw UDP socket and reads multiple datagrams per
+// recvmmsg(2) syscall, using golang.org/x/net/ipv4's batch API the same way
+// x/net's own UDP transports do. It falls back to a single ReadMsgUDP call
+// per ReadBatch when the kernel returns ENOSYS, so callers don't need to handle
+// both modes themselves.
+type batchConn struct {
+	conn      *net.UDPConn
+	pc        *ipv4.PacketConn
+	batchSize int
+	msgs      []ipv4.Message
+
+	useSingleRecv bool
+}
+
+func newBatchConn(c *net.UDPConn, batchSize int) (*batchConn, error) {
+	if batchSize <= 0 {
+		batchSize = defaultBatchSize
+	}
+	pc := ipv4.NewPacketConn(c)
+	if err := pc.SetControlMessage(ipv4.FlagDst|ipv4.FlagInterface, true); err != nil && !errors.Is(err, unix.ENOPROTOOPT) {
+		return nil, err
+	}
+	if err := setReceivePktInfo(c); err != nil && !errors.Is(err, unix.ENOPROTOOPT) {
+		return nil, err
+	}
+	if err := setUDPGRO(c); err != nil && !errors.Is(err, unix.ENOPROTOOPT) {
+		return nil, err
+	}
+	if err := setReceiveTOS(c); err != nil && !errors.Is(err, unix.ENOPROTOOPT) {
+		return nil, err
+	}
+
+	msgs := make([]ipv4.Message, batchSize)
+	for i := range msgs {
+		msgs[i].Buffers = [][]byte{make([]byte, maxPacketBufferSize)}
+		msgs[i].OOB = make([]byte, oobBufferSize)
+	}
+	return &batchConn{conn: c, pc: pc, batchSize: batchSize, msgs: msgs}, nil
+}
+
+// setUDPGRO enables UDP_GRO on the socket so the kernel coalesces multiple
+// datagrams from the same flow into a single recvmsg/recvmmsg buffer,
+// reducing per-packet syscall overhead on receive.
+func setUDPGRO(c *net.UDPConn) error {
+	rawConn, err := c.SyscallConn()
+	if err != nil {
+		return err
+	}
+	var serr error
+	if err := rawConn.Control(func(fd uintptr) {
+		serr = unix.SetsockoptInt(int(fd), unix.IPPROTO_UDP, unix.UDP_GRO, 1)
+	}); err != nil {
+		return err
+	}
+	return serr
+}
+
+// setReceivePktInfo enables IPV6_RECVPKTINFO on the socket. The IPv4
+// counterpart is already requested via pc.SetControlMessage above, but
+// that call is scoped to golang.org/x/net/ipv4 and never touches the
+// IPPROTO_IPV6 socket option, so a udp6 socket would otherwise never
+// receive an IPV6_PKTINFO cmsg for parseBatchControlData to parse.
+func setReceivePktInfo(c *net.UDPConn) error {
+	rawConn, err := c.SyscallConn()
+	if err != nil {
+		return err
+	}
+	var serr error
+	if err := rawConn.Control(func(fd uintptr) {
+		serr = unix.SetsockoptInt(int(fd), unix.IPPROTO_IPV6, unix.IPV6_RECVPKTINFO, 1)
+	}); err != nil {
+		return err
+	}
+	return serr
+}
+
+// setReceiveTOS enables IP_RECVTOS and IPV6_RECVTCLASS on the socket so
+// received datagrams carry their ECN marking as ancillary data, regardless
+// of which IP version the socket ends up receiving on.
+func setReceiveTOS(c *net.UDPConn) error {
+	rawConn, err := c.SyscallConn()
+	if err != nil {
+		return err
+	}
+	var serr error
+	if err := rawConn.Control(func(fd uintptr) {
+		if err := unix.SetsockoptInt(int(fd), unix.IPPROTO_IP, unix.IP_RECVTOS, 1); err != nil && !errors.Is(err, unix.ENOPROTOOPT) {
+			serr = err
+			return
+		}
+		if err := unix.SetsockoptInt(int(fd), unix.IPPROTO_IPV6, unix.IPV6_RECVTCLASS, 1); err != nil && !errors.Is(err, unix.ENOPROTOOPT) {
+			serr = err
+			return
+		}
+	}); err != nil {
+		return err
+	}
+	return serr
+}
+
+// ReadBatch reads up to batchSize datagrams in a single recvmmsg(2) call. A
+// single coalesced GRO message may be split into several receivedPackets,
+// one per segment, so the returned slice can be longer than the number of
+// messages the kernel reported.
+func (b *batchConn) ReadBatch() ([]receivedPacket, error) {
+	if b.useSingleRecv {
+		return b.readSingle()
+	}
+
+	n, err := b.pc.ReadBatch(b.msgs, unix.MSG_WAITFORONE)
+	if err != nil {
+		if errors.Is(err, syscall.ENOSYS) {
+			b.useSingleRecv = true
+			return b.readSingle()
+		}
+		return nil, err
+	}
+
+	now := time.Now()
+	var packets []receivedPacket
+	for i := 0; i < n; i++ {
+		msg := b.msgs[i]
+		data := msg.Buffers[0][:msg.N]
+		info, groSize, ecn := parseBatchControlData(msg.OOB[:msg.NN])
+		packets = append(packets, segmentGRO(data, groSize, msg.Addr, now, info, ecn)...)
+	}
+	return packets, nil
+}
+
+func (b *batchConn) readSingle() ([]receivedPacket, error) {
+	buf := b.msgs[0].Buffers[0]
+	oob := b.msgs[0].OOB
+	n, oobn, _, remote, err := b.conn.ReadMsgUDP(buf, oob)
+	if err != nil {
+		return nil, err
+	}
+	info, groSize, ecn := parseBatchControlData(oob[:oobn])
+	return segmentGRO(buf[:n], groSize, remote, time.Now(), info, ecn), nil
+}
+
+// segmentGRO splits a (possibly GRO-coalesced) datagram into one
+// receivedPacket per segment of groSize bytes. A groSize of 0 means the
+// datagram wasn't coalesced. Every segment shares the same info and ecn,
+// since both are properties of the underlying datagram, not a segment.
+func segmentGRO(data []byte, groSize int, remote net.Addr, rcvTime time.Time, info packetInfo, ecn ECN) []receivedPacket {
+	if groSize <= 0 || groSize >= len(data) {
+		return []receivedPacket{{remoteAddr: remote, rcvTime: rcvTime, data: data, info: info, ecn: ecn}}
+	}
+	var packets []receivedPacket
+	for len(data) > 0 && len(packets) < maxGROSegments {
+		n := groSize
+		if n > len(data) {
+			n = len(data)
+		}
+		packets = append(packets, receivedPacket{remoteAddr: remote, rcvTime: rcvTime, data: data[:n], info: info, ecn: ecn})
+		data = data[n:]
+	}
+	return packets
+}
+
+// parseBatchControlData extracts the destination address / interface index,
+// the UDP_GRO segment size, and the ECN marking (from an IP_TOS or
+// IPV6_TCLASS cmsg, populated because of setReceiveTOS), all from a
+// message's out-of-band control data. PKTINFO is parsed by hand for both
+// address families rather than via x/net/ipv4's ControlMessage.Parse, which
+// only ever recognizes the IPv4 form and silently leaves info at its zero
+// value for packets received on a udp6 socket.
+func parseBatchControlData(oob []byte) (packetInfo, int, ECN) {
+	var info packetInfo
+	groSize := 0
+	var ecn ECN
+	if cmsgs, err := unix.ParseSocketControlMessage(oob); err == nil {
+		for _, cmsg := range cmsgs {
+			switch {
+			case cmsg.Header.Level == unix.IPPROTO_IP && cmsg.Header.Type == unix.IP_PKTINFO:
+				if addr, ifIndex, ok := parseIPv4PktInfo(cmsg.Data); ok {
+					info = packetInfo{addr: addr, ifIndex: ifIndex}
+				}
+			case cmsg.Header.Level == unix.IPPROTO_IPV6 && cmsg.Header.Type == unix.IPV6_PKTINFO:
+				if addr, ifIndex, ok := parseIPv6PktInfo(cmsg.Data); ok {
+					info = packetInfo{addr: addr, ifIndex: ifIndex}
+				}
+			case cmsg.Header.Level == unix.IPPROTO_UDP && cmsg.Header.Type == unix.UDP_GRO && len(cmsg.Data) >= 2:
+				groSize = int(cmsg.Data[0]) | int(cmsg.Data[1])<<8
+			case cmsg.Header.Level == unix.IPPROTO_IP && cmsg.Header.Type == unix.IP_TOS && len(cmsg.Data) >= 1:
+				// The kernel delivers IP_TOS as a single byte.
+				ecn = ECN(cmsg.Data[0] & 0x3)
+			case cmsg.Header.Level == unix.IPPROTO_IPV6 && cmsg.Header.Type == unix.IPV6_TCLASS && len(cmsg.Data) >= 4:
+				// Unlike IP_TOS, the kernel delivers IPV6_TCLASS as a
+				// native-endian int, so the traffic class byte isn't
+				// always Data[0]; reuse the same byte-order switch
+				// parseIPv4PktInfo uses for in_pktinfo's ifindex.
+				ecn = ECN(nativeEndianUint32(cmsg.Data) & 0x3)
+			}
+		}
+	}
+	return info, groSize, ecn
+}
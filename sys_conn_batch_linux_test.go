@@ -0,0 +1,187 @@
+//go:build linux
+
+package quic
+
+import (
+	"net"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseBatchControlDataECN(t *testing.T) {
+	t.Run("IPv4 IP_TOS", func(t *testing.T) {
+		oob := appendTOSCmsg(nil, 0x2, false) // ECT(0) in the low two bits
+		_, _, ecn := parseBatchControlData(oob)
+		require.Equal(t, ECNECT0, ecn)
+	})
+
+	t.Run("IPv6 IPV6_TCLASS", func(t *testing.T) {
+		// The kernel delivers IPV6_TCLASS as a native-endian 4 byte int,
+		// unlike IP_TOS's single byte, so this also exercises the
+		// byte-order handling in parseBatchControlData.
+		oob := appendTOSCmsg(nil, 0x3, true) // CE in the low two bits
+		_, _, ecn := parseBatchControlData(oob)
+		require.Equal(t, ECNCE, ecn)
+	})
+}
+
+func TestSegmentGRO(t *testing.T) {
+	remote := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 1234}
+	info := packetInfo{addr: netip.MustParseAddr("127.0.0.1"), ifIndex: 1}
+	now := time.Now()
+
+	t.Run("not coalesced", func(t *testing.T) {
+		data := make([]byte, 100)
+		packets := segmentGRO(data, 0, remote, now, info, ECNECT0)
+		require.Len(t, packets, 1)
+		require.Equal(t, 100, len(packets[0].data))
+		require.Equal(t, ECNECT0, packets[0].ecn)
+	})
+
+	t.Run("coalesced into equal segments", func(t *testing.T) {
+		data := make([]byte, 300)
+		packets := segmentGRO(data, 100, remote, now, info, ECNCE)
+		require.Len(t, packets, 3)
+		for _, p := range packets {
+			require.Equal(t, 100, len(p.data))
+			require.Equal(t, info, p.info)
+			require.Equal(t, ECNCE, p.ecn)
+		}
+	})
+
+	t.Run("coalesced with a short final segment", func(t *testing.T) {
+		data := make([]byte, 250)
+		packets := segmentGRO(data, 100, remote, now, info, ECNNon)
+		require.Len(t, packets, 3)
+		require.Equal(t, 50, len(packets[2].data))
+	})
+}
+
+// TestBatchConnReadBatch exercises ReadBatch against a real socket (rather
+// than useSingleRecv, as TestBatchConnFallsBackToSingleRecv does), covering
+// two cases the recvmmsg path needs to get right: a partial batch (fewer
+// datagrams arrive than batchSize) and a batch that mixes datagrams from
+// more than one remote in the same recvmmsg(2) call.
+func TestBatchConnReadBatch(t *testing.T) {
+	c, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	require.NoError(t, err)
+	defer c.Close()
+
+	const batchSize = 8
+	b, err := newBatchConn(c, batchSize)
+	require.NoError(t, err)
+
+	t.Run("partial batch", func(t *testing.T) {
+		client, err := net.DialUDP("udp", nil, c.LocalAddr().(*net.UDPAddr))
+		require.NoError(t, err)
+		defer client.Close()
+
+		// Send fewer datagrams than batchSize; ReadBatch must not block
+		// waiting for a full batch.
+		_, err = client.Write([]byte("one"))
+		require.NoError(t, err)
+		_, err = client.Write([]byte("two"))
+		require.NoError(t, err)
+
+		require.NoError(t, c.SetReadDeadline(time.Now().Add(time.Second)))
+		packets, err := b.ReadBatch()
+		require.NoError(t, err)
+		require.Len(t, packets, 2)
+		require.Equal(t, []byte("one"), packets[0].data)
+		require.Equal(t, []byte("two"), packets[1].data)
+	})
+
+	t.Run("mixed remotes in the same batch", func(t *testing.T) {
+		clientA, err := net.DialUDP("udp", nil, c.LocalAddr().(*net.UDPAddr))
+		require.NoError(t, err)
+		defer clientA.Close()
+		clientB, err := net.DialUDP("udp", nil, c.LocalAddr().(*net.UDPAddr))
+		require.NoError(t, err)
+		defer clientB.Close()
+
+		// Fired back-to-back from two different 4-tuples so the kernel
+		// has a chance to deliver both in a single recvmmsg(2) call; one
+		// flow sends several small datagrams in a row (which UDP_GRO may
+		// coalesce into one message), the other sends a single datagram
+		// (which never gets coalesced, since there's nothing to coalesce
+		// it with). Either way, ReadBatch must account for all the bytes
+		// sent, regardless of which messages the kernel happened to group.
+		_, err = clientA.Write([]byte("aaa"))
+		require.NoError(t, err)
+		_, err = clientA.Write([]byte("bbb"))
+		require.NoError(t, err)
+		_, err = clientB.Write([]byte("ccccc"))
+		require.NoError(t, err)
+
+		require.NoError(t, c.SetReadDeadline(time.Now().Add(time.Second)))
+		var gotFromA, gotFromB []byte
+		for len(gotFromA) < 6 || len(gotFromB) < 5 {
+			packets, err := b.ReadBatch()
+			require.NoError(t, err)
+			for _, p := range packets {
+				switch p.remoteAddr.(*net.UDPAddr).Port {
+				case clientA.LocalAddr().(*net.UDPAddr).Port:
+					gotFromA = append(gotFromA, p.data...)
+				case clientB.LocalAddr().(*net.UDPAddr).Port:
+					gotFromB = append(gotFromB, p.data...)
+				}
+			}
+		}
+		require.Equal(t, []byte("aaabbb"), gotFromA)
+		require.Equal(t, []byte("ccccc"), gotFromB)
+	})
+}
+
+// TestBatchConnReadBatchIPv6PktInfo reads from a real udp6 socket and checks
+// that packetInfo.addr/ifIndex come back populated. ipv4.ControlMessage.Parse
+// only ever recognizes IPv4's IP_PKTINFO, so before parseBatchControlData
+// parsed IPV6_PKTINFO by hand this silently left info at its zero value for
+// every packet received on an IPv6 socket.
+func TestBatchConnReadBatchIPv6PktInfo(t *testing.T) {
+	c, err := net.ListenUDP("udp6", &net.UDPAddr{IP: net.IPv6loopback})
+	if err != nil {
+		t.Skipf("IPv6 loopback not available: %v", err)
+	}
+	defer c.Close()
+
+	b, err := newBatchConn(c, defaultBatchSize)
+	require.NoError(t, err)
+
+	client, err := net.DialUDP("udp6", nil, c.LocalAddr().(*net.UDPAddr))
+	require.NoError(t, err)
+	defer client.Close()
+	_, err = client.Write([]byte("hello"))
+	require.NoError(t, err)
+
+	require.NoError(t, c.SetReadDeadline(time.Now().Add(time.Second)))
+	packets, err := b.ReadBatch()
+	require.NoError(t, err)
+	require.Len(t, packets, 1)
+	require.Equal(t, netip.MustParseAddr("::1"), packets[0].info.addr)
+	require.NotZero(t, packets[0].info.ifIndex)
+}
+
+func TestBatchConnFallsBackToSingleRecv(t *testing.T) {
+	c, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	require.NoError(t, err)
+	defer c.Close()
+
+	b, err := newBatchConn(c, 4)
+	require.NoError(t, err)
+	b.useSingleRecv = true
+
+	client, err := net.DialUDP("udp", nil, c.LocalAddr().(*net.UDPAddr))
+	require.NoError(t, err)
+	defer client.Close()
+	_, err = client.Write([]byte("hello"))
+	require.NoError(t, err)
+
+	require.NoError(t, c.SetReadDeadline(time.Now().Add(time.Second)))
+	packets, err := b.ReadBatch()
+	require.NoError(t, err)
+	require.Len(t, packets, 1)
+	require.Equal(t, []byte("hello"), packets[0].data)
+}
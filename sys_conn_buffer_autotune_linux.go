@@ -0,0 +1,177 @@
+//go:build linux
+
+package quic
+
+import (
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+const (
+	rmemMaxPath = "/proc/sys/net/core/rmem_max"
+	wmemMaxPath = "/proc/sys/net/core/wmem_max"
+
+	// fallbackProbeStart is the starting point for the exponential
+	// downgrade probe used when /proc/sys/net/core/{r,w}mem_max can't be
+	// read, e.g. inside containers with a restricted /proc.
+	fallbackProbeStart = 32 << 20 // 32 MB
+	fallbackProbeFloor = 64 << 10 // 64 KB
+)
+
+// autoTuneReceiveBuffer finds the largest receive buffer size the kernel
+// will actually grant for c, without requiring CAP_NET_ADMIN. It first
+// consults rmem_max via /proc, then binary-searches between the current
+// size and that max using plain SO_RCVBUF (never SO_RCVBUFFORCE).
+func autoTuneReceiveBuffer(c syscall.RawConn) (BufferStats, error) {
+	current, err := inspectReadBuffer(c)
+	if err != nil {
+		return BufferStats{}, err
+	}
+	max, ok := readSysctlInt(rmemMaxPath)
+	if !ok {
+		granted, err := probeBufferSize(current, fallbackProbeStart, func(n int) (int, error) {
+			if err := setReceiveBuffer(c, n); err != nil {
+				return 0, err
+			}
+			return inspectReadBuffer(c)
+		})
+		if err != nil {
+			return BufferStats{}, err
+		}
+		// probeBufferSize returns the size it requested, not what the
+		// kernel reports; report what the socket is actually left with.
+		if granted, err = inspectReadBuffer(c); err != nil {
+			return BufferStats{}, err
+		}
+		return BufferStats{Requested: fallbackProbeStart, Granted: granted}, nil
+	}
+
+	granted, err := binarySearchBuffer(current, max, func(n int) (int, error) {
+		if err := setReceiveBuffer(c, n); err != nil {
+			return 0, err
+		}
+		return inspectReadBuffer(c)
+	})
+	if err != nil {
+		return BufferStats{}, err
+	}
+	return BufferStats{Requested: max, Granted: granted, KernelMax: max}, nil
+}
+
+// autoTuneSendBuffer is the send-side counterpart of autoTuneReceiveBuffer.
+func autoTuneSendBuffer(c syscall.RawConn) (BufferStats, error) {
+	current, err := inspectWriteBuffer(c)
+	if err != nil {
+		return BufferStats{}, err
+	}
+	max, ok := readSysctlInt(wmemMaxPath)
+	if !ok {
+		granted, err := probeBufferSize(current, fallbackProbeStart, func(n int) (int, error) {
+			if err := setSendBuffer(c, n); err != nil {
+				return 0, err
+			}
+			return inspectWriteBuffer(c)
+		})
+		if err != nil {
+			return BufferStats{}, err
+		}
+		// probeBufferSize returns the size it requested, not what the
+		// kernel reports; report what the socket is actually left with.
+		if granted, err = inspectWriteBuffer(c); err != nil {
+			return BufferStats{}, err
+		}
+		return BufferStats{Requested: fallbackProbeStart, Granted: granted}, nil
+	}
+
+	granted, err := binarySearchBuffer(current, max, func(n int) (int, error) {
+		if err := setSendBuffer(c, n); err != nil {
+			return 0, err
+		}
+		return inspectWriteBuffer(c)
+	})
+	if err != nil {
+		return BufferStats{}, err
+	}
+	return BufferStats{Requested: max, Granted: granted, KernelMax: max}, nil
+}
+
+func setReceiveBuffer(c syscall.RawConn, bytes int) error {
+	var serr error
+	if err := c.Control(func(fd uintptr) {
+		serr = syscall.SetsockoptInt(int(fd), syscall.SOL_SOCKET, syscall.SO_RCVBUF, bytes)
+	}); err != nil {
+		return err
+	}
+	return serr
+}
+
+func setSendBuffer(c syscall.RawConn, bytes int) error {
+	var serr error
+	if err := c.Control(func(fd uintptr) {
+		serr = syscall.SetsockoptInt(int(fd), syscall.SOL_SOCKET, syscall.SO_SNDBUF, bytes)
+	}); err != nil {
+		return err
+	}
+	return serr
+}
+
+// binarySearchBuffer finds the largest requested size in (lo, hi] that the
+// kernel grants in full, i.e. where apply(size) reports back at least
+// 2*size (the kernel doubles whatever it grants, per SO_RCVBUF/SO_SNDBUF
+// semantics), and returns what the kernel actually granted for it.
+func binarySearchBuffer(lo, hi int, apply func(int) (int, error)) (int, error) {
+	best := lo
+	for lo < hi {
+		mid := lo + (hi-lo+1)/2
+		granted, err := apply(mid)
+		if err != nil {
+			return 0, err
+		}
+		if granted >= 2*mid {
+			best = mid
+			lo = mid
+		} else {
+			hi = mid - 1
+		}
+	}
+	// The last apply call above may have been a failed candidate above
+	// best, which leaves the socket's actual buffer smaller than best.
+	// Re-apply the winning size so the returned value, and what's left set
+	// on the socket, both reflect it.
+	return apply(best)
+}
+
+// probeBufferSize is used when the kernel's sysctl max can't be read (e.g.
+// a container with a read-only /proc). It starts at start and halves the
+// request until the kernel grants it or we fall below fallbackProbeFloor.
+func probeBufferSize(current, start int, apply func(int) (int, error)) (int, error) {
+	best := current
+	for size := start; size >= fallbackProbeFloor; size /= 2 {
+		granted, err := apply(size)
+		if err != nil {
+			continue
+		}
+		if granted >= 2*size {
+			best = size
+			break
+		}
+		if granted > best {
+			best = granted
+		}
+	}
+	return best, nil
+}
+
+func readSysctlInt(path string) (int, bool) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return 0, false
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(string(b)))
+	if err != nil {
+		return 0, false
+	}
+	return n, true
+}
@@ -0,0 +1,51 @@
+//go:build linux
+
+package quic
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAutoTuneReceiveBuffer(t *testing.T) {
+	c, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer c.Close()
+	syscallConn, err := c.(*net.UDPConn).SyscallConn()
+	require.NoError(t, err)
+
+	stats, err := autoTuneReceiveBuffer(syscallConn)
+	require.NoError(t, err)
+	require.False(t, stats.UsedForce)
+	require.Greater(t, stats.Granted, 0)
+
+	size, err := inspectReadBuffer(syscallConn)
+	require.NoError(t, err)
+	require.Equal(t, size, stats.Granted)
+}
+
+func TestAutoTuneSendBuffer(t *testing.T) {
+	c, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer c.Close()
+	syscallConn, err := c.(*net.UDPConn).SyscallConn()
+	require.NoError(t, err)
+
+	stats, err := autoTuneSendBuffer(syscallConn)
+	require.NoError(t, err)
+	require.Greater(t, stats.Granted, 0)
+}
+
+func TestProbeBufferSizeWithoutSysctl(t *testing.T) {
+	granted, err := probeBufferSize(1<<16, 1<<20, func(n int) (int, error) {
+		// simulate a kernel that only ever grants up to 256KB
+		if n > 256<<10 {
+			return 0, nil
+		}
+		return 2 * n, nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, 256<<10, granted)
+}
@@ -0,0 +1,128 @@
+//go:build linux
+
+package quic
+
+import (
+	"encoding/binary"
+	"errors"
+	"net/netip"
+	"os"
+	"runtime"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+func forceSetReceiveBuffer(c syscall.RawConn, bytes int) error {
+	var serr error
+	if err := c.Control(func(fd uintptr) {
+		serr = unix.SetsockoptInt(int(fd), unix.SOL_SOCKET, unix.SO_RCVBUFFORCE, bytes)
+	}); err != nil {
+		return err
+	}
+	return serr
+}
+
+func forceSetSendBuffer(c syscall.RawConn, bytes int) error {
+	var serr error
+	if err := c.Control(func(fd uintptr) {
+		serr = unix.SetsockoptInt(int(fd), unix.SOL_SOCKET, unix.SO_SNDBUFFORCE, bytes)
+	}); err != nil {
+		return err
+	}
+	return serr
+}
+
+func inspectReadBuffer(c syscall.RawConn) (int, error) {
+	var (
+		size int
+		serr error
+	)
+	if err := c.Control(func(fd uintptr) {
+		size, serr = unix.GetsockoptInt(int(fd), unix.SOL_SOCKET, unix.SO_RCVBUF)
+	}); err != nil {
+		return 0, err
+	}
+	return size, serr
+}
+
+func inspectWriteBuffer(c syscall.RawConn) (int, error) {
+	var (
+		size int
+		serr error
+	)
+	if err := c.Control(func(fd uintptr) {
+		size, serr = unix.GetsockoptInt(int(fd), unix.SOL_SOCKET, unix.SO_SNDBUF)
+	}); err != nil {
+		return 0, err
+	}
+	return size, serr
+}
+
+func isGSOError(err error) bool {
+	var serr *os.SyscallError
+	if errors.As(err, &serr) {
+		return serr.Err == unix.EIO
+	}
+	return false
+}
+
+func isPermissionError(err error) bool {
+	var serr *os.SyscallError
+	if errors.As(err, &serr) {
+		return serr.Err == unix.EPERM
+	}
+	return false
+}
+
+// parseIPv4PktInfo parses the body of an IP_PKTINFO control message,
+// returning the destination address and the interface index it was
+// received on.
+func parseIPv4PktInfo(body []byte) (ip netip.Addr, ifIndex uint32, ok bool) {
+	// struct in_pktinfo {
+	//   unsigned int   ipi_ifindex;
+	//   struct in_addr ipi_spec_dst;
+	//   struct in_addr ipi_addr;
+	// };
+	if len(body) != 12 {
+		return netip.Addr{}, 0, false
+	}
+	switch runtime.GOARCH {
+	case "s390x", "ppc64", "mips", "mips64":
+		ifIndex = binary.BigEndian.Uint32(body)
+	default:
+		ifIndex = binary.LittleEndian.Uint32(body)
+	}
+	ip = netip.AddrFrom4([4]byte{body[8], body[9], body[10], body[11]})
+	return ip, ifIndex, true
+}
+
+// parseIPv6PktInfo parses the body of an IPV6_PKTINFO control message,
+// returning the destination address and the interface index it was
+// received on.
+func parseIPv6PktInfo(body []byte) (ip netip.Addr, ifIndex uint32, ok bool) {
+	// struct in6_pktinfo {
+	//   struct in6_addr ipi6_addr;
+	//   unsigned int    ipi6_ifindex;
+	// };
+	if len(body) != 20 {
+		return netip.Addr{}, 0, false
+	}
+	var addr [16]byte
+	copy(addr[:], body[:16])
+	ifIndex = nativeEndianUint32(body[16:])
+	return netip.AddrFrom16(addr), ifIndex, true
+}
+
+// nativeEndianUint32 decodes the first 4 bytes of b as the C int the
+// kernel uses for most single-value cmsgs (e.g. IPV6_TCLASS), which is laid
+// out in the host's native byte order rather than always network byte
+// order.
+func nativeEndianUint32(b []byte) uint32 {
+	switch runtime.GOARCH {
+	case "s390x", "ppc64", "mips", "mips64":
+		return binary.BigEndian.Uint32(b)
+	default:
+		return binary.LittleEndian.Uint32(b)
+	}
+}
@@ -0,0 +1,235 @@
+//go:build linux
+
+package quic
+
+import (
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// maxReusePortGroupSize is a sanity bound on the number of sockets in a
+// SO_REUSEPORT group that the generated cBPF program indexes into.
+// The kernel's cBPF verifier rejects absurdly large programs long before
+// this would matter in practice.
+const maxReusePortGroupSize = 256
+
+// maxDCIDLen is the largest legal QUIC destination connection ID, per RFC
+// 9000 section 17.2.
+const maxDCIDLen = 20
+
+// newReusePortSteeringFilter builds a classic BPF program that steers
+// incoming UDP datagrams within a SO_REUSEPORT socket group by QUIC
+// connection ID rather than by 4-tuple. Long header packets carry the DCID
+// length at byte 5 and the DCID itself starting at byte 6; short header
+// packets carry a DCID of connIDLen bytes starting at byte 1.
+//
+// The filter loads the CID bytes into the BPF accumulator via a sequence of
+// BPF_LD+BPF_B loads combined with BPF_ALU+BPF_XOR, which is a cheap stand-in
+// for an FNV-1a style mix that the kernel's cBPF verifier accepts, and
+// finishes with BPF_ALU+BPF_MOD against numSockets followed by BPF_RET.
+//
+// Classic BPF has no SK_NONE equivalent to fall back to the kernel's default
+// 4-tuple hash (that only exists for the eBPF SO_ATTACH_REUSEPORT_EBPF path,
+// via bpf_sk_select_reuseport). So rather than let an out-of-range
+// BPF_LD_ABS fault silently route every too-short or malformed packet to
+// socket index 0 as an implementation accident, the program explicitly
+// length-checks the packet before each header it reads and returns index 0
+// on purpose when it's too short to carry a full CID. This is a deliberate,
+// documented choice, not a correctness guarantee that such packets are
+// grouped usefully; callers that need the 4-tuple fallback behavior have to
+// use the eBPF path instead.
+func newReusePortSteeringFilter(connIDLen, numSockets int) []unix.SockFilter {
+	const (
+		longHeaderForm  = 0x80 // the high (header form) bit of byte 0 is set for long headers
+		dcidLenOffset   = 5
+		longDCIDOffset  = 6
+		shortDCIDOffset = 1
+	)
+
+	// FNV-1a offset basis, folded into a 32 bit accumulator kept in the BPF
+	// scratch memory (M[0]).
+	const fnvOffsetBasis = 0x811c9dc5
+	const fnvPrime = 0x01000193
+
+	mix := func(byteOffset uint32) []unix.SockFilter {
+		return []unix.SockFilter{
+			{Code: unix.BPF_LD | unix.BPF_B | unix.BPF_ABS, K: byteOffset},
+			{Code: unix.BPF_ALU | unix.BPF_XOR | unix.BPF_X},
+			{Code: unix.BPF_ALU | unix.BPF_MUL | unix.BPF_K, K: fnvPrime},
+			{Code: unix.BPF_ST, K: 0},
+		}
+	}
+
+	const (
+		mixUnitSize      = 5 // BPF_LDX|BPF_MEM, then mix's 4 instructions
+		lenCheckSize     = 2 // BPF_LD_ABS of the length byte, then BPF_JEQ
+		perUnitWithCheck = mixUnitSize + lenCheckSize
+	)
+
+	// A program built entirely out of forward jumps (the cBPF verifier
+	// rejects backward jumps, since it has no loop construct to detect) can
+	// only reference a target that comes later in the instruction stream.
+	// "too short" is only known once we've already started laying out the
+	// body, so every check that needs it records the index of its jump
+	// instruction here; insufficientLenRet, appended last, is backpatched in
+	// at the end once every index is final.
+	var prog []unix.SockFilter
+	var tooShortJumps []int
+	appendInstrs := func(instrs []unix.SockFilter, tooShortRel []int) {
+		base := len(prog)
+		prog = append(prog, instrs...)
+		for _, rel := range tooShortRel {
+			tooShortJumps = append(tooShortJumps, base+rel)
+		}
+	}
+
+	// lenGuard checks the packet is at least minLen bytes, falling through
+	// when it is and jumping to insufficientLenRet (once backpatched) when
+	// it isn't.
+	lenGuard := func(minLen uint32) ([]unix.SockFilter, []int) {
+		return []unix.SockFilter{
+			{Code: unix.BPF_LD | unix.BPF_W | unix.BPF_LEN},
+			{Code: unix.BPF_JMP | unix.BPF_JGE | unix.BPF_K, Jt: 0, Jf: 0, K: minLen},
+		}, []int{1}
+	}
+
+	// Initialize M[0] = fnvOffsetBasis unconditionally, before the
+	// header-type branch below. The verifier rejects any path that reads
+	// M[0] (via BPF_LDX|BPF_MEM in mix's preceding load) without first
+	// writing it, so this can't be deferred into just one of the two
+	// branches.
+	appendInstrs([]unix.SockFilter{
+		{Code: unix.BPF_LD | unix.BPF_IMM, K: fnvOffsetBasis},
+		{Code: unix.BPF_ST, K: 0},
+	}, nil)
+	g, gRel := lenGuard(1) // enough to safely read byte 0 below
+	appendInstrs(g, gRel)
+	appendInstrs([]unix.SockFilter{
+		// A = packet[0]
+		{Code: unix.BPF_LD | unix.BPF_B | unix.BPF_ABS, K: 0},
+		// A &= 0x80
+		{Code: unix.BPF_ALU | unix.BPF_AND | unix.BPF_K, K: longHeaderForm},
+	}, nil)
+
+	// Short-header path: guard the packet is long enough to hold connIDLen
+	// bytes of DCID, then mix them. connIDLen is a configured constant (the
+	// length of locally generated connection IDs), so unlike the
+	// long-header path there's no runtime-variable length to branch on.
+	var shortBody []unix.SockFilter
+	var shortRel []int
+	g, gRel = lenGuard(uint32(shortDCIDOffset + connIDLen))
+	shortBody = append(shortBody, g...)
+	shortRel = append(shortRel, gRel...)
+	for i := 0; i < connIDLen; i++ {
+		shortBody = append(shortBody, unix.SockFilter{Code: unix.BPF_LDX | unix.BPF_MEM, K: 0})
+		shortBody = append(shortBody, mix(uint32(shortDCIDOffset+i))...)
+	}
+
+	// Long-header path: the DCID length is a runtime value read from the
+	// packet at dcidLenOffset, so cBPF (which can't loop on a
+	// runtime-variable trip count) can't mix exactly that many bytes with a
+	// single unrolled loop. Instead, unroll mixing one byte at a time and,
+	// after each byte, check whether the declared length has been reached;
+	// if so, jump straight to the final hash/return, skipping the
+	// still-unrolled mixing of any bytes past the real DCID. A declared
+	// length of 0 is checked before the loop, skipping it entirely. Lengths
+	// above maxDCIDLen (not legal QUIC, since DCIDs are capped at 20 bytes)
+	// are treated the same as exactly maxDCIDLen.
+	var longBody []unix.SockFilter
+	var longRel []int
+	g, gRel = lenGuard(uint32(longDCIDOffset + maxDCIDLen))
+	longBody = append(longBody, g...)
+	longRel = append(longRel, gRel...)
+
+	// Precompute, for the check after unit i, how many instructions remain
+	// until the final hash/return section starts (i.e. how far the "we've
+	// reached the declared length" jump needs to travel).
+	remaining := make([]int, maxDCIDLen-1)
+	remaining[maxDCIDLen-2] = mixUnitSize
+	for i := maxDCIDLen - 3; i >= 0; i-- {
+		remaining[i] = perUnitWithCheck + remaining[i+1]
+	}
+	loopSize := perUnitWithCheck*(maxDCIDLen-1) + mixUnitSize
+
+	// A declared length of 0: no bytes to mix, skip the whole loop.
+	longBody = append(longBody,
+		unix.SockFilter{Code: unix.BPF_LD | unix.BPF_B | unix.BPF_ABS, K: dcidLenOffset},
+		unix.SockFilter{Code: unix.BPF_JMP | unix.BPF_JEQ | unix.BPF_K, Jt: uint8(loopSize), Jf: 0, K: 0},
+	)
+	for i := 0; i < maxDCIDLen; i++ {
+		longBody = append(longBody, unix.SockFilter{Code: unix.BPF_LDX | unix.BPF_MEM, K: 0})
+		longBody = append(longBody, mix(uint32(longDCIDOffset+i))...)
+		if i < maxDCIDLen-1 {
+			longBody = append(longBody,
+				unix.SockFilter{Code: unix.BPF_LD | unix.BPF_B | unix.BPF_ABS, K: dcidLenOffset},
+				unix.SockFilter{Code: unix.BPF_JMP | unix.BPF_JEQ | unix.BPF_K, Jt: uint8(remaining[i]), Jf: 0, K: uint32(i + 1)},
+			)
+		}
+	}
+
+	// if (A != 0) goto longHeader, skipping the short-header body and the
+	// JA that follows it; otherwise fall through into the short-header body.
+	appendInstrs([]unix.SockFilter{
+		{Code: unix.BPF_JMP | unix.BPF_JEQ | unix.BPF_K, Jt: 0, Jf: uint8(len(shortBody) + 1), K: 0},
+	}, nil)
+	appendInstrs(shortBody, shortRel)
+	// Skip the long-header body; the short-header path is done.
+	appendInstrs([]unix.SockFilter{
+		{Code: unix.BPF_JMP | unix.BPF_JA, K: uint32(len(longBody))},
+	}, nil)
+	appendInstrs(longBody, longRel)
+
+	// A = M[0] % numSockets; return A
+	appendInstrs([]unix.SockFilter{
+		{Code: unix.BPF_LD | unix.BPF_MEM, K: 0},
+		{Code: unix.BPF_ALU | unix.BPF_MOD | unix.BPF_K, K: uint32(numSockets)},
+		{Code: unix.BPF_RET | unix.BPF_A},
+	}, nil)
+
+	// The explicit "too short to hold a full CID" return. See the doc
+	// comment above: index 0 here is a deliberate, documented choice, not
+	// an accident of the verifier's out-of-range-load behavior, since cBPF
+	// has no SK_NONE to fall back to the kernel's 4-tuple hash with.
+	insufficientLenRet := len(prog)
+	prog = append(prog, unix.SockFilter{Code: unix.BPF_RET | unix.BPF_K, K: 0})
+	for _, idx := range tooShortJumps {
+		prog[idx].Jf = uint8(insufficientLenRet - (idx + 1))
+	}
+
+	return prog
+}
+
+// attachReusePortSteering attaches a cBPF program to a SO_REUSEPORT socket
+// group that selects a member socket by QUIC connection ID instead of the
+// kernel's default 4-tuple hash. numSockets is the size of the reuseport
+// group; connIDLen is the length, in bytes, of locally generated connection
+// IDs (see Transport.ConnectionIDLength).
+//
+// c must refer to a socket that has already been bound (e.g. one a
+// net.ListenConfig produced). Attaching the program from a
+// net.ListenConfig.Control callback, which runs before bind, attaches it to
+// a socket that hasn't joined the reuseport group yet; the kernel then
+// rejects the group merge at bind time with EADDRINUSE, even though every
+// member already has SO_REUSEPORT set.
+func attachReusePortSteering(c syscall.RawConn, connIDLen, numSockets int) error {
+	prog := newReusePortSteeringFilter(connIDLen, numSockets)
+	fprog := unix.SockFprog{
+		Len:    uint16(len(prog)),
+		Filter: &prog[0],
+	}
+	var serr error
+	if err := c.Control(func(fd uintptr) {
+		// The kernel requires SO_REUSEPORT to already be set on the socket
+		// before it will accept a reuseport cBPF program; it's also what
+		// lets multiple sockets bind to the same address in the first
+		// place.
+		if serr = unix.SetsockoptInt(int(fd), unix.SOL_SOCKET, unix.SO_REUSEPORT, 1); serr != nil {
+			return
+		}
+		serr = unix.SetsockoptSockFprog(int(fd), unix.SOL_SOCKET, unix.SO_ATTACH_REUSEPORT_CBPF, &fprog)
+	}); err != nil {
+		return err
+	}
+	return serr
+}
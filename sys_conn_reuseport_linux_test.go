@@ -0,0 +1,157 @@
+//go:build linux
+
+package quic
+
+import (
+	"context"
+	"net"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	"golang.org/x/sys/unix"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestReusePortSteeringFilterShape(t *testing.T) {
+	prog := newReusePortSteeringFilter(8, 4)
+	require.NotEmpty(t, prog)
+	// The program's last instruction is the explicit "too short to hold a
+	// full CID" fallback (BPF_RET|BPF_K, returning index 0), not the
+	// hash-based return; that one is reached via a forward jump earlier in
+	// the program once the real hash has been computed.
+	last := prog[len(prog)-1]
+	require.Equal(t, uint16(unix.BPF_RET|unix.BPF_K), last.Code)
+	require.Equal(t, uint32(0), last.K)
+
+	var sawHashReturn bool
+	for _, instr := range prog {
+		if instr.Code == uint16(unix.BPF_RET|unix.BPF_A) {
+			sawHashReturn = true
+		}
+	}
+	require.True(t, sawHashReturn, "program never computes and returns the connection-ID hash")
+}
+
+// newReusePortSteeringGroup binds numSockets UDP sockets to the same
+// address, joins them into a SO_REUSEPORT group, and attaches the
+// connection-ID steering filter. It's shared by every test that sends
+// packets through the group and checks which socket they land on.
+func newReusePortSteeringGroup(t *testing.T, connIDLen, numSockets int) (conns []*net.UDPConn, groupAddr string) {
+	t.Helper()
+	for i := 0; i < numSockets; i++ {
+		listenAddr := groupAddr
+		if listenAddr == "" {
+			listenAddr = "127.0.0.1:0"
+		}
+		lc := net.ListenConfig{
+			Control: func(_, _ string, c syscall.RawConn) error {
+				var serr error
+				if err := c.Control(func(fd uintptr) {
+					serr = unix.SetsockoptInt(int(fd), unix.SOL_SOCKET, unix.SO_REUSEPORT, 1)
+				}); err != nil {
+					return err
+				}
+				return serr
+			},
+		}
+		pc, err := lc.ListenPacket(context.Background(), "udp", listenAddr)
+		require.NoError(t, err)
+		t.Cleanup(func() { pc.Close() })
+		conns = append(conns, pc.(*net.UDPConn))
+		if i == 0 {
+			groupAddr = pc.LocalAddr().String()
+		}
+	}
+
+	// The cBPF program is attached once each socket has actually joined the
+	// reuseport group (i.e. after bind, not from ListenConfig.Control,
+	// which runs before bind): attaching it pre-bind makes the kernel
+	// reject the later group merge, failing bind with EADDRINUSE even
+	// though every socket already has SO_REUSEPORT set.
+	for _, c := range conns {
+		rawConn, err := c.SyscallConn()
+		require.NoError(t, err)
+		require.NoError(t, attachReusePortSteering(rawConn, connIDLen, numSockets))
+	}
+	return conns, groupAddr
+}
+
+// readFromOne sends packet to groupAddr and returns the index of the single
+// socket in conns that received it.
+func readFromOne(t *testing.T, conns []*net.UDPConn, groupAddr string, packet []byte) int {
+	t.Helper()
+	remoteAddr, err := net.ResolveUDPAddr("udp", groupAddr)
+	require.NoError(t, err)
+	client, err := net.DialUDP("udp", nil, remoteAddr)
+	require.NoError(t, err)
+	defer client.Close()
+
+	_, err = client.Write(packet)
+	require.NoError(t, err)
+
+	buf := make([]byte, 1500)
+	hit := -1
+	for i, c := range conns {
+		require.NoError(t, c.SetReadDeadline(time.Now().Add(100*time.Millisecond)))
+		n, _, err := c.ReadFromUDP(buf)
+		if err == nil && n > 0 {
+			require.Equal(t, -1, hit, "packet landed on more than one socket")
+			hit = i
+		}
+	}
+	require.NotEqual(t, -1, hit, "packet landed on no socket")
+	return hit
+}
+
+func TestReusePortSteering(t *testing.T) {
+	if os.Getuid() != 0 {
+		t.Skip("Must be root to attach a SO_ATTACH_REUSEPORT_CBPF filter")
+	}
+
+	const connIDLen = 8
+	const numSockets = 4
+	conns, groupAddr := newReusePortSteeringGroup(t, connIDLen, numSockets)
+
+	// A short header packet with a known DCID should land on exactly one
+	// socket in the group.
+	dcid := []byte{1, 2, 3, 4, 5, 6, 7, 8}
+	packet := append([]byte{0x40}, dcid...)
+	readFromOne(t, conns, groupAddr, packet)
+}
+
+// TestReusePortSteeringLongHeaderDCIDLength checks that the long-header path
+// only mixes the bytes inside the declared DCID length, not a fixed window
+// past it: two packets sharing the same (short) DCID, differing only in the
+// bytes the kernel leaves unmixed beyond that length, must land on the same
+// socket. TestReusePortSteering alone never exercises this path, since it
+// only ever sends a short-header packet.
+func TestReusePortSteeringLongHeaderDCIDLength(t *testing.T) {
+	if os.Getuid() != 0 {
+		t.Skip("Must be root to attach a SO_ATTACH_REUSEPORT_CBPF filter")
+	}
+
+	const connIDLen = 8
+	const numSockets = 4
+	conns, groupAddr := newReusePortSteeringGroup(t, connIDLen, numSockets)
+
+	dcid := []byte{1, 2, 3, 4, 5, 6, 7, 8}
+	// The length guard in newReusePortSteeringFilter requires the packet to
+	// be at least longDCIDOffset+maxDCIDLen (26) bytes before it'll mix
+	// anything at all, so pad well past that; the padding bytes are what
+	// differs between the two packets below, to prove they're not mixed in.
+	longHeader := func(pad byte) []byte {
+		packet := []byte{0xc0, 0, 0, 0, 1, byte(len(dcid))} // long header, DCID length 8
+		packet = append(packet, dcid...)
+		for i := 0; i < 20; i++ {
+			packet = append(packet, pad)
+		}
+		return packet
+	}
+
+	first := readFromOne(t, conns, groupAddr, longHeader(0xaa))
+	second := readFromOne(t, conns, groupAddr, longHeader(0x11))
+	require.Equal(t, first, second)
+}
@@ -0,0 +1,34 @@
+//go:build linux
+
+package quic
+
+import (
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// appendTOSCmsg appends ancillary data setting the IP TOS (IPv4) or
+// IPV6_TCLASS (IPv6) byte to oob, for use alongside the existing GSO cmsg
+// on a WriteMsgUDP/sendmsg call. isIPv6 selects which option is emitted,
+// since the two aren't interchangeable on a dual-stack socket.
+func appendTOSCmsg(oob []byte, tos uint8, isIPv6 bool) []byte {
+	if isIPv6 {
+		return appendCmsg(oob, unix.IPPROTO_IPV6, unix.IPV6_TCLASS, int32(tos))
+	}
+	return appendCmsg(oob, unix.IPPROTO_IP, unix.IP_TOS, int32(tos))
+}
+
+// appendCmsg appends a single cmsg carrying a 4 byte int32 value, the same
+// ancillary data shape IP_TOS, IPV6_TCLASS and most other int-valued socket
+// options use.
+func appendCmsg(oob []byte, level, typ int, val int32) []byte {
+	start := len(oob)
+	oob = append(oob, make([]byte, unix.CmsgSpace(4))...)
+	h := (*unix.Cmsghdr)(unsafe.Pointer(&oob[start]))
+	h.Level = int32(level)
+	h.Type = int32(typ)
+	h.SetLen(unix.CmsgLen(4))
+	*(*int32)(unsafe.Pointer(&oob[start+unix.CmsgLen(0)])) = val
+	return oob
+}
@@ -0,0 +1,41 @@
+//go:build linux
+
+package quic
+
+import (
+	"testing"
+
+	"golang.org/x/sys/unix"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAppendTOSCmsg(t *testing.T) {
+	t.Run("IPv4", func(t *testing.T) {
+		oob := appendTOSCmsg(nil, 0x2e, false)
+		cmsgs, err := unix.ParseSocketControlMessage(oob)
+		require.NoError(t, err)
+		require.Len(t, cmsgs, 1)
+		require.Equal(t, int32(unix.IPPROTO_IP), cmsgs[0].Header.Level)
+		require.Equal(t, int32(unix.IP_TOS), cmsgs[0].Header.Type)
+		require.Equal(t, byte(0x2e), cmsgs[0].Data[0])
+	})
+
+	t.Run("IPv6", func(t *testing.T) {
+		oob := appendTOSCmsg(nil, 0x2e, true)
+		cmsgs, err := unix.ParseSocketControlMessage(oob)
+		require.NoError(t, err)
+		require.Len(t, cmsgs, 1)
+		require.Equal(t, int32(unix.IPPROTO_IPV6), cmsgs[0].Header.Level)
+		require.Equal(t, int32(unix.IPV6_TCLASS), cmsgs[0].Header.Type)
+		require.Equal(t, byte(0x2e), cmsgs[0].Data[0])
+	})
+
+	t.Run("appends alongside an existing cmsg", func(t *testing.T) {
+		oob := appendCmsg(nil, unix.IPPROTO_UDP, unix.UDP_SEGMENT, 1350)
+		oob = appendTOSCmsg(oob, 0x2e, false)
+		cmsgs, err := unix.ParseSocketControlMessage(oob)
+		require.NoError(t, err)
+		require.Len(t, cmsgs, 2)
+	})
+}
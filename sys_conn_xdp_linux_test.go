@@ -0,0 +1,95 @@
+//go:build linux
+
+package quic
+
+import (
+	"encoding/binary"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// buildUDPv4Frame assembles a minimal Ethernet/IPv4/UDP frame carrying
+// payload, destined for dstPort. The Ethernet and IP header fields that
+// parseXDPFrame doesn't inspect (MACs, IP checksum, TTL, ...) are left
+// zeroed.
+func buildUDPv4Frame(srcPort, dstPort uint16, payload []byte) []byte {
+	frame := make([]byte, ethHeaderLen+20+udpHeaderLen+len(payload))
+	binary.BigEndian.PutUint16(frame[12:14], ethTypeIPv4)
+
+	ip := frame[ethHeaderLen:]
+	ip[0] = 0x45 // version 4, IHL 5 (20 bytes)
+	ip[9] = 17   // protocol UDP
+	copy(ip[12:16], []byte{10, 0, 0, 1})
+	copy(ip[16:20], []byte{10, 0, 0, 2})
+
+	udp := ip[20:]
+	binary.BigEndian.PutUint16(udp[0:2], srcPort)
+	binary.BigEndian.PutUint16(udp[2:4], dstPort)
+	copy(udp[udpHeaderLen:], payload)
+
+	return frame
+}
+
+func TestParseXDPFrame(t *testing.T) {
+	now := time.Now()
+
+	t.Run("matching port", func(t *testing.T) {
+		frame := buildUDPv4Frame(5555, 4433, []byte("hello"))
+		p, ok := parseXDPFrame(frame, 3, 4433, now)
+		require.True(t, ok)
+		require.Equal(t, []byte("hello"), p.data)
+		require.Equal(t, uint32(3), p.info.ifIndex)
+		require.Equal(t, "10.0.0.1:5555", p.remoteAddr.String())
+	})
+
+	t.Run("port mismatch is dropped", func(t *testing.T) {
+		frame := buildUDPv4Frame(5555, 4433, []byte("hello"))
+		_, ok := parseXDPFrame(frame, 3, 9999, now)
+		require.False(t, ok)
+	})
+
+	t.Run("truncated frame is dropped", func(t *testing.T) {
+		frame := buildUDPv4Frame(5555, 4433, []byte("hello"))
+		_, ok := parseXDPFrame(frame[:ethHeaderLen+10], 3, 4433, now)
+		require.False(t, ok)
+	})
+}
+
+// fakeXDPSocket is a minimal in-memory XDPSocket for exercising xdpConn
+// without a real AF_XDP ring.
+type fakeXDPSocket struct {
+	frames [][]byte
+	filled []XDPDesc
+}
+
+func (f *fakeXDPSocket) FD() int { return -1 }
+
+func (f *fakeXDPSocket) Receive(n int) []XDPDesc {
+	descs := make([]XDPDesc, len(f.frames))
+	for i := range f.frames {
+		descs[i] = XDPDesc{Addr: uint64(i), Len: uint32(len(f.frames[i]))}
+	}
+	return descs
+}
+
+func (f *fakeXDPSocket) GetFrame(d XDPDesc) []byte { return f.frames[d.Addr] }
+
+func (f *fakeXDPSocket) Fill(descs []XDPDesc) { f.filled = append(f.filled, descs...) }
+
+func TestXDPConnReadBatch(t *testing.T) {
+	sock := &fakeXDPSocket{frames: [][]byte{
+		buildUDPv4Frame(1111, 4433, []byte("a")),
+		buildUDPv4Frame(2222, 9999, []byte("dropped")), // wrong port
+		buildUDPv4Frame(3333, 4433, []byte("b")),
+	}}
+	conn := newXDPConn(sock, 7, 4433)
+
+	packets, err := conn.ReadBatch()
+	require.NoError(t, err)
+	require.Len(t, packets, 2)
+	require.Equal(t, []byte("a"), packets[0].data)
+	require.Equal(t, []byte("b"), packets[1].data)
+	require.Len(t, sock.filled, 3)
+}
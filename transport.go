@@ -0,0 +1,121 @@
+package quic
+
+import (
+	"net"
+	"sync"
+)
+
+// A Transport of QUIC on a single net.PacketConn.
+// It allows running client and server connections on the same UDP socket
+// and sharing a single connection ID generator across them.
+type Transport struct {
+	// A single net.PacketConn can only be used for a single Transport.
+	// Reusing the same Transport is faster than creating a new one,
+	// since it saves a syscall for setting up the socket options.
+	Conn net.PacketConn
+
+	createdConn bool
+	isSingleUse bool
+
+	initOnce sync.Once
+	initErr  error
+	// sockImpl holds the platform-specific socket machinery (batched
+	// receive, AF_XDP, ...) built by init. Its concrete type is
+	// platform-specific; today that's *linuxConn, the only platform any of
+	// these features support.
+	sockImpl any
+
+	// ConnectionIDLength is the length, in bytes, of locally generated
+	// connection IDs. It is used by features (such as EnableReusePortSteering)
+	// that need to parse connection IDs out of a raw packet before a
+	// quic.Connection exists for it.
+	ConnectionIDLength int
+
+	// EnableReusePortSteering attaches a classic BPF program to the socket
+	// (via SO_ATTACH_REUSEPORT_CBPF) that steers packets within a SO_REUSEPORT
+	// socket group by connection ID instead of the kernel's default 4-tuple
+	// hash. This is required for connection migration to keep working when
+	// multiple Transports share the same listen address for horizontal
+	// scaling: without it, a packet sent from a new client path can land on
+	// a socket that has never seen that connection. Only supported on Linux.
+	//
+	// ReusePortGroupSize must also be set to the number of Transports
+	// sharing the listen address for this to take effect.
+	EnableReusePortSteering bool
+
+	// ReusePortGroupSize is the number of sockets in the SO_REUSEPORT group
+	// that EnableReusePortSteering's cBPF program selects between. It must
+	// match the number of Transports (or other sockets) sharing the listen
+	// address; a mismatch steers packets to the wrong group member.
+	ReusePortGroupSize int
+
+	// ReceiveBatchSize controls how many datagrams are read per recvmmsg(2)
+	// syscall on platforms that support batched receive (currently Linux
+	// only). A value of 0 (or less) selects the default batch size of 8.
+	ReceiveBatchSize int
+
+	// AutoTuneBuffers, if set, probes the kernel for the largest receive and
+	// send buffer sizes it will actually grant (bounded by
+	// /proc/sys/net/core/rmem_max and wmem_max) instead of requiring
+	// CAP_NET_ADMIN to force a specific size. The result is available via
+	// BufferStats after the Transport has been initialized. Linux only; a
+	// no-op on other platforms.
+	AutoTuneBuffers bool
+
+	bufferStats TransportBufferStats
+
+	// XDPSocket, if set, bypasses the standard net.PacketConn receive path
+	// in favor of reading raw frames from an AF_XDP socket bound to a
+	// specific NIC queue. This is for servers pushing well beyond what
+	// GRO + recvmmsg can sustain (1M+ pps). Callers supply a type satisfying
+	// XDPSocket, e.g. an adapter around a *github.com/asavie/xdp.Socket.
+	// The send path is unaffected and continues to use Conn. Linux only;
+	// requires CAP_NET_RAW. The caller is responsible for pinning the
+	// goroutine driving the Transport to the CPU servicing the queue's
+	// interrupts.
+	XDPSocket XDPSocket
+
+	// XDPInterfaceIndex is the interface index of the NIC queue XDPSocket
+	// is bound to. It's reported on receivedPacket.info.ifIndex, since the
+	// AF_XDP socket itself carries no notion of which interface produced a
+	// given frame.
+	XDPInterfaceIndex int
+
+	// WriteControl, if set, is consulted for every outgoing datagram and
+	// lets callers set the IP TOS (IPv4) / Traffic Class (IPv6) byte on it,
+	// e.g. to mark ECT(0)/ECT(1) for L4S or SCE experimentation, or a DSCP
+	// value to prioritize Initial packets over application data. When ok is
+	// false, the datagram is sent without a TOS cmsg, i.e. with whatever
+	// the kernel defaults to. Linux only; a no-op on other platforms.
+	WriteControl func(p *Packet) (tos uint8, ok bool)
+}
+
+// Packet is a single outgoing UDP datagram, as passed to
+// Transport.WriteControl before it's written to the wire.
+type Packet struct {
+	Addr net.Addr
+	Data []byte
+}
+
+// BufferStats reports the outcome of an AutoTuneBuffers probe for one
+// direction (receive or send) of a socket.
+type BufferStats struct {
+	Requested int
+	Granted   int
+	KernelMax int
+	UsedForce bool
+}
+
+// TransportBufferStats reports the outcome of an AutoTuneBuffers probe,
+// separately for the receive and send buffers; the kernel grants each
+// independently, so one tuning the other down isn't a given.
+type TransportBufferStats struct {
+	Rx BufferStats
+	Tx BufferStats
+}
+
+// BufferStats returns the result of the most recent AutoTuneBuffers probe.
+// It is the zero value if AutoTuneBuffers was not enabled.
+func (t *Transport) BufferStats() TransportBufferStats {
+	return t.bufferStats
+}
@@ -0,0 +1,135 @@
+//go:build linux
+
+package quic
+
+import (
+	"fmt"
+	"net"
+)
+
+// linuxConn holds the socket machinery init sets up from Transport's
+// optional fields; it's stored in Transport.sockImpl so non-Linux builds
+// don't need to know about it. Exactly one of batch and xdp is set: xdp
+// when Transport.XDPSocket is configured, batch otherwise. udpConn is
+// always set, since the send path runs over it even when XDPSocket is in
+// use for receive.
+type linuxConn struct {
+	udpConn *net.UDPConn
+	batch   *batchConn
+	xdp     *xdpConn
+}
+
+// init applies the Linux-only socket setup implied by the Transport's
+// optional fields. It runs once, lazily, the first time the connection
+// dispatch loop needs the underlying raw socket.
+func (t *Transport) init() error {
+	t.initOnce.Do(func() {
+		t.initErr = t.initLocked()
+	})
+	return t.initErr
+}
+
+func (t *Transport) initLocked() error {
+	udpConn, ok := t.Conn.(*net.UDPConn)
+	if !ok {
+		if t.EnableReusePortSteering {
+			return fmt.Errorf("quic: EnableReusePortSteering requires Transport.Conn to be a *net.UDPConn")
+		}
+		return nil
+	}
+
+	if t.EnableReusePortSteering {
+		if t.ReusePortGroupSize <= 0 {
+			return fmt.Errorf("quic: EnableReusePortSteering requires ReusePortGroupSize to be set")
+		}
+		if t.ReusePortGroupSize > maxReusePortGroupSize {
+			return fmt.Errorf("quic: ReusePortGroupSize %d exceeds the maximum of %d", t.ReusePortGroupSize, maxReusePortGroupSize)
+		}
+		if t.ConnectionIDLength <= 0 {
+			return fmt.Errorf("quic: EnableReusePortSteering requires ConnectionIDLength to be set")
+		}
+		rawConn, err := udpConn.SyscallConn()
+		if err != nil {
+			return err
+		}
+		if err := attachReusePortSteering(rawConn, t.ConnectionIDLength, t.ReusePortGroupSize); err != nil {
+			return fmt.Errorf("quic: attaching reuseport steering filter: %w", err)
+		}
+	}
+
+	if t.AutoTuneBuffers {
+		rawConn, err := udpConn.SyscallConn()
+		if err != nil {
+			return err
+		}
+		rx, err := autoTuneReceiveBuffer(rawConn)
+		if err != nil {
+			return fmt.Errorf("quic: auto-tuning receive buffer: %w", err)
+		}
+		tx, err := autoTuneSendBuffer(rawConn)
+		if err != nil {
+			return fmt.Errorf("quic: auto-tuning send buffer: %w", err)
+		}
+		t.bufferStats = TransportBufferStats{Rx: rx, Tx: tx}
+	}
+
+	if t.XDPSocket != nil {
+		if !hasNetRawCapability() {
+			return fmt.Errorf("quic: XDPSocket requires CAP_NET_RAW")
+		}
+		udpAddr, ok := udpConn.LocalAddr().(*net.UDPAddr)
+		if !ok {
+			return fmt.Errorf("quic: XDPSocket requires Transport.Conn to be bound to a UDP port")
+		}
+		t.sockImpl = &linuxConn{
+			udpConn: udpConn,
+			xdp:     newXDPConn(t.XDPSocket, uint32(t.XDPInterfaceIndex), uint16(udpAddr.Port)),
+		}
+		return nil
+	}
+
+	batch, err := newBatchConn(udpConn, t.ReceiveBatchSize)
+	if err != nil {
+		return fmt.Errorf("quic: setting up batched receive: %w", err)
+	}
+	t.sockImpl = &linuxConn{udpConn: udpConn, batch: batch}
+	return nil
+}
+
+// readPacket reads the next batch of receivedPackets off the wire, via the
+// AF_XDP RX ring when Transport.XDPSocket is set, or recvmmsg(2) (falling
+// back to a single recvmsg(2) call) otherwise. It's the Linux receive entry
+// point the connection dispatch loop calls into.
+func (t *Transport) readPacket() ([]receivedPacket, error) {
+	if err := t.init(); err != nil {
+		return nil, err
+	}
+	lc := t.sockImpl.(*linuxConn)
+	if lc.xdp != nil {
+		return lc.xdp.ReadBatch()
+	}
+	return lc.batch.ReadBatch()
+}
+
+// writePacket sends p on the wire, attaching an IP_TOS/IPV6_TCLASS cmsg
+// when Transport.WriteControl opts in for this datagram. It's the Linux
+// send entry point the connection dispatch loop calls into.
+func (t *Transport) writePacket(p *Packet) (int, error) {
+	if err := t.init(); err != nil {
+		return 0, err
+	}
+	udpAddr, ok := p.Addr.(*net.UDPAddr)
+	if !ok {
+		return 0, fmt.Errorf("quic: writePacket requires a *net.UDPAddr, got %T", p.Addr)
+	}
+
+	var oob []byte
+	if t.WriteControl != nil {
+		if tos, ok := t.WriteControl(p); ok {
+			oob = appendTOSCmsg(oob, tos, udpAddr.IP.To4() == nil)
+		}
+	}
+
+	n, _, err := t.sockImpl.(*linuxConn).udpConn.WriteMsgUDP(p.Data, oob, udpAddr)
+	return n, err
+}
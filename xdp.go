@@ -0,0 +1,27 @@
+package quic
+
+// XDPDesc mirrors the descriptor format used by github.com/asavie/xdp's
+// fill, RX, TX and completion rings: an offset into the UMEM area (Addr)
+// and the length of the frame stored there (Len).
+type XDPDesc struct {
+	Addr uint64
+	Len  uint32
+}
+
+// XDPSocket is the subset of github.com/asavie/xdp.Socket's API that
+// Transport's AF_XDP receive path depends on. Its methods take and return
+// XDPDesc, which is this package's own type, so a *xdp.Socket does not
+// satisfy it as is; an adapter that converts descriptors does, as can any
+// other type, e.g. in tests. See Transport.XDPSocket.
+type XDPSocket interface {
+	// FD returns the underlying AF_XDP socket file descriptor.
+	FD() int
+	// Receive returns up to n descriptors for frames that have arrived on
+	// the RX ring, blocking until at least one is available.
+	Receive(n int) []XDPDesc
+	// GetFrame returns the UMEM-backed frame referenced by d.
+	GetFrame(d XDPDesc) []byte
+	// Fill returns descs to the fill ring so the kernel can reuse their
+	// frames for subsequent receives.
+	Fill(descs []XDPDesc)
+}